@@ -0,0 +1,212 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"math/rand"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"kubevault.dev/vault_exporter/pkg/mapper"
+)
+
+// CacheType selects the eviction policy used by a mappingCache.
+type CacheType string
+
+const (
+	CacheTypeLRU    CacheType = "lru"
+	CacheTypeRandom CacheType = "random"
+)
+
+var (
+	mapperCacheGets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "statsd_exporter_mapper_cache_gets_total",
+		Help: "The total number of metric mapper cache lookups, by outcome.",
+	}, []string{"cache_type", "result"})
+
+	mapperCacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "statsd_exporter_mapper_cache_evictions_total",
+		Help: "The total number of metric mapper cache evictions.",
+	}, []string{"cache_type"})
+)
+
+func init() {
+	prometheus.MustRegister(mapperCacheGets, mapperCacheEvictions)
+}
+
+// mappingCacheKey identifies a single (metric name, metric type) lookup.
+type mappingCacheKey struct {
+	metricName string
+	metricType mapper.MetricType
+}
+
+// mappingCacheValue is the resolved result of a GetMapping call.
+type mappingCacheValue struct {
+	mapping *mapper.MetricMapping
+	labels  map[string]string
+	present bool
+}
+
+// mappingCache fronts mapper.MetricMapper.GetMapping so that repeated
+// glob/regex matching for hot metric names doesn't happen on every event.
+type mappingCache interface {
+	get(key mappingCacheKey) (mappingCacheValue, bool)
+	put(key mappingCacheKey, value mappingCacheValue)
+	reset()
+}
+
+// newMappingCache builds the cache implementation selected by cacheType,
+// sized to hold at most size entries. An unrecognized cacheType falls back
+// to LRU.
+func newMappingCache(cacheType CacheType, size int) mappingCache {
+	if size <= 0 {
+		return newNoopMappingCache()
+	}
+	if cacheType == CacheTypeRandom {
+		return newRandomMappingCache(size)
+	}
+	return newLRUMappingCache(size)
+}
+
+// noopMappingCache disables caching, used when --mapper.cache-size=0.
+type noopMappingCache struct{}
+
+func newNoopMappingCache() *noopMappingCache { return &noopMappingCache{} }
+
+func (c *noopMappingCache) get(mappingCacheKey) (mappingCacheValue, bool) { return mappingCacheValue{}, false }
+func (c *noopMappingCache) put(mappingCacheKey, mappingCacheValue)        {}
+func (c *noopMappingCache) reset()                                       {}
+
+// lruMappingCache evicts the least-recently-used entry once full.
+type lruMappingCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[mappingCacheKey]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key   mappingCacheKey
+	value mappingCacheValue
+}
+
+func newLRUMappingCache(size int) *lruMappingCache {
+	return &lruMappingCache{
+		size:    size,
+		entries: map[mappingCacheKey]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *lruMappingCache) get(key mappingCacheKey) (mappingCacheValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		mapperCacheGets.WithLabelValues(string(CacheTypeLRU), "miss").Inc()
+		return mappingCacheValue{}, false
+	}
+	c.order.MoveToFront(el)
+	mapperCacheGets.WithLabelValues(string(CacheTypeLRU), "hit").Inc()
+	return el.Value.(*lruEntry).value, true
+}
+
+func (c *lruMappingCache) put(key mappingCacheKey, value mappingCacheValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*lruEntry).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*lruEntry).key)
+			mapperCacheEvictions.WithLabelValues(string(CacheTypeLRU)).Inc()
+		}
+	}
+
+	el := c.order.PushFront(&lruEntry{key: key, value: value})
+	c.entries[key] = el
+}
+
+func (c *lruMappingCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[mappingCacheKey]*list.Element{}
+	c.order.Init()
+}
+
+// randomMappingCache evicts a uniformly random entry once full, trading the
+// LRU's recency tracking for a simpler cache that's cheaper to update on
+// every hit. Go only randomizes a map's iteration *start*, not the order in
+// which keys are visited from there, so picking the first key encountered
+// in a range is not itself uniform; the victim is instead chosen with
+// math/rand over an explicit key list.
+type randomMappingCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[mappingCacheKey]mappingCacheValue
+}
+
+func newRandomMappingCache(size int) *randomMappingCache {
+	return &randomMappingCache{
+		size:    size,
+		entries: map[mappingCacheKey]mappingCacheValue{},
+	}
+}
+
+func (c *randomMappingCache) get(key mappingCacheKey) (mappingCacheValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.entries[key]
+	if !ok {
+		mapperCacheGets.WithLabelValues(string(CacheTypeRandom), "miss").Inc()
+		return mappingCacheValue{}, false
+	}
+	mapperCacheGets.WithLabelValues(string(CacheTypeRandom), "hit").Inc()
+	return value, true
+}
+
+func (c *randomMappingCache) put(key mappingCacheKey, value mappingCacheValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		keys := make([]mappingCacheKey, 0, len(c.entries))
+		for k := range c.entries {
+			keys = append(keys, k)
+		}
+		evict := keys[rand.Intn(len(keys))]
+		delete(c.entries, evict)
+		mapperCacheEvictions.WithLabelValues(string(CacheTypeRandom)).Inc()
+	}
+	c.entries[key] = value
+}
+
+func (c *randomMappingCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[mappingCacheKey]mappingCacheValue{}
+}
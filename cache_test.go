@@ -0,0 +1,59 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestLRUMappingCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRUMappingCache(2)
+	k1 := mappingCacheKey{metricName: "a"}
+	k2 := mappingCacheKey{metricName: "b"}
+	k3 := mappingCacheKey{metricName: "c"}
+
+	c.put(k1, mappingCacheValue{present: true})
+	c.put(k2, mappingCacheValue{present: true})
+	// Touch k1 so k2 becomes the least-recently-used entry.
+	if _, ok := c.get(k1); !ok {
+		t.Fatal("expected k1 to be cached")
+	}
+	c.put(k3, mappingCacheValue{present: true})
+
+	if _, ok := c.get(k2); ok {
+		t.Error("expected k2 to have been evicted")
+	}
+	if _, ok := c.get(k1); !ok {
+		t.Error("expected k1 to still be cached")
+	}
+	if _, ok := c.get(k3); !ok {
+		t.Error("expected k3 to still be cached")
+	}
+}
+
+func TestRandomMappingCacheEvictsAtCapacity(t *testing.T) {
+	c := newRandomMappingCache(2)
+	k1 := mappingCacheKey{metricName: "a"}
+	k2 := mappingCacheKey{metricName: "b"}
+	k3 := mappingCacheKey{metricName: "c"}
+
+	c.put(k1, mappingCacheValue{present: true})
+	c.put(k2, mappingCacheValue{present: true})
+	c.put(k3, mappingCacheValue{present: true})
+
+	if len(c.entries) != 2 {
+		t.Fatalf("expected cache to stay at capacity 2, got %d entries", len(c.entries))
+	}
+	if _, ok := c.get(k3); !ok {
+		t.Error("expected the just-inserted key to be present")
+	}
+}
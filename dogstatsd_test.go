@@ -0,0 +1,100 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestParseDogStatsDEvent(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	ev, err := parseDogStatsDEvent("_e{5,9}:title|text body|t:warning|#env:prod", logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, ok := ev.(*EventEvent)
+	if !ok {
+		t.Fatalf("expected *EventEvent, got %T", ev)
+	}
+	if e.title != "title" {
+		t.Errorf("title = %q, want %q", e.title, "title")
+	}
+	if e.text != "text body" {
+		t.Errorf("text = %q, want %q", e.text, "text body")
+	}
+	if e.alertType != "warning" {
+		t.Errorf("alertType = %q, want %q", e.alertType, "warning")
+	}
+	if e.labels["env"] != "prod" {
+		t.Errorf("labels[env] = %q, want %q", e.labels["env"], "prod")
+	}
+}
+
+func TestParseDogStatsDEventNegativeLength(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	if _, err := parseDogStatsDEvent("_e{-1,10}:title|text body", logger); err == nil {
+		t.Error("expected an error for a negative title length, got nil")
+	}
+	if _, err := parseDogStatsDEvent("_e{5,-1}:title|text body", logger); err == nil {
+		t.Error("expected an error for a negative text length, got nil")
+	}
+}
+
+func TestParseDogStatsDEventShortBody(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	if _, err := parseDogStatsDEvent("_e{5,10}:title|short", logger); err == nil {
+		t.Error("expected an error for a body shorter than the declared lengths, got nil")
+	}
+}
+
+func TestParseDogStatsDServiceCheck(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	ev, err := parseDogStatsDServiceCheck("_sc|app.ok|0|h:host1|#env:prod|m:all good", logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sc, ok := ev.(*ServiceCheckEvent)
+	if !ok {
+		t.Fatalf("expected *ServiceCheckEvent, got %T", ev)
+	}
+	if sc.status != 0 {
+		t.Errorf("status = %v, want 0", sc.status)
+	}
+	if sc.labels["name"] != "app.ok" {
+		t.Errorf("labels[name] = %q, want %q", sc.labels["name"], "app.ok")
+	}
+	if sc.labels["hostname"] != "host1" {
+		t.Errorf("labels[hostname] = %q, want %q", sc.labels["hostname"], "host1")
+	}
+	if sc.labels["env"] != "prod" {
+		t.Errorf("labels[env] = %q, want %q", sc.labels["env"], "prod")
+	}
+	if sc.message != "all good" {
+		t.Errorf("message = %q, want %q", sc.message, "all good")
+	}
+}
+
+func TestParseDogStatsDServiceCheckShortBody(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	if _, err := parseDogStatsDServiceCheck("_sc|app.ok", logger); err == nil {
+		t.Error("expected an error for a service check missing its status field, got nil")
+	}
+}
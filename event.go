@@ -0,0 +1,114 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "kubevault.dev/vault_exporter/pkg/mapper"
+
+// Event is a single parsed StatsD line, normalized to whichever Prometheus
+// metric type it will end up as.
+type Event interface {
+	MetricName() string
+	Value() float64
+	Labels() map[string]string
+	MetricType() mapper.MetricType
+}
+
+// Events is a batch of Event parsed from one StatsD packet or line.
+type Events []Event
+
+// eventHandler receives batches of parsed Events from the listeners.
+type eventHandler interface {
+	queue(events Events)
+}
+
+type CounterEvent struct {
+	metricName string
+	value      float64
+	labels     map[string]string
+}
+
+func (c *CounterEvent) MetricName() string           { return c.metricName }
+func (c *CounterEvent) Value() float64               { return c.value }
+func (c *CounterEvent) Labels() map[string]string    { return c.labels }
+func (c *CounterEvent) MetricType() mapper.MetricType { return mapper.MetricTypeCounter }
+
+type GaugeEvent struct {
+	metricName string
+	value      float64
+	relative   bool
+	labels     map[string]string
+}
+
+func (g *GaugeEvent) MetricName() string           { return g.metricName }
+func (g *GaugeEvent) Value() float64               { return g.value }
+func (g *GaugeEvent) Labels() map[string]string    { return g.labels }
+func (g *GaugeEvent) MetricType() mapper.MetricType { return mapper.MetricTypeGauge }
+
+type TimerEvent struct {
+	metricName string
+	value      float64
+	labels     map[string]string
+}
+
+func (t *TimerEvent) MetricName() string           { return t.metricName }
+func (t *TimerEvent) Value() float64                { return t.value }
+func (t *TimerEvent) Labels() map[string]string     { return t.labels }
+func (t *TimerEvent) MetricType() mapper.MetricType { return mapper.MetricTypeTimer }
+
+// EventEvent is a DogStatsD event (`_e{title_len,text_len}:title|text|...`).
+type EventEvent struct {
+	metricName string
+	title      string
+	text       string
+	alertType  string
+	priority   string
+	source     string
+	timestamp  int64
+	labels     map[string]string
+}
+
+func (e *EventEvent) MetricName() string           { return e.metricName }
+func (e *EventEvent) Value() float64                { return 1 }
+func (e *EventEvent) Labels() map[string]string     { return e.labels }
+func (e *EventEvent) MetricType() mapper.MetricType { return mapper.MetricTypeEvent }
+
+// ServiceCheckEvent is a DogStatsD service check (`_sc|name|status|...`).
+// Status follows the DogStatsD convention: 0 = OK, 1 = WARNING,
+// 2 = CRITICAL, 3 = UNKNOWN.
+type ServiceCheckEvent struct {
+	metricName string
+	status     float64
+	message    string
+	labels     map[string]string
+}
+
+func (s *ServiceCheckEvent) MetricName() string           { return s.metricName }
+func (s *ServiceCheckEvent) Value() float64                { return s.status }
+func (s *ServiceCheckEvent) Labels() map[string]string     { return s.labels }
+func (s *ServiceCheckEvent) MetricType() mapper.MetricType { return mapper.MetricTypeServiceCheck }
+
+// SetEvent is a StatsD set (`s` type). Unlike the other event types it
+// carries the member that was added to the set rather than a numeric
+// amount: SetValue returns that member, and Value always returns 0.
+type SetEvent struct {
+	metricName string
+	value      string
+	labels     map[string]string
+}
+
+func (s *SetEvent) MetricName() string           { return s.metricName }
+func (s *SetEvent) Value() float64                { return 0 }
+func (s *SetEvent) SetValue() string              { return s.value }
+func (s *SetEvent) Labels() map[string]string     { return s.labels }
+func (s *SetEvent) MetricType() mapper.MetricType { return mapper.MetricTypeSet }
@@ -16,11 +16,14 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"net"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -49,9 +52,34 @@ func (u uncheckedCollector) Collect(c chan<- prometheus.Metric) {
 }
 
 type Exporter struct {
-	mapper   *mapper.MetricMapper
-	registry *registry
-	logger   log.Logger
+	mapper *mapper.MetricMapper
+	cache  mappingCache
+	logger log.Logger
+
+	// vecs is the single shared set of Prometheus collectors, keyed by
+	// resolved metric name, that every shard below updates into. Keeping
+	// it unsharded means a metric name can only ever have one label-name
+	// set, exactly as a single (unsharded) registry would enforce.
+	vecs *vecRegistry
+
+	// shards partitions per-series TTL/set-cardinality bookkeeping by
+	// hash(metricName) so that events for different metrics can be
+	// processed without contending on a single lock. The underlying
+	// Prometheus collectors themselves live in vecs, not here.
+	shards []*registry
+
+	// relay optionally forwards every non-dropped event to downstream
+	// StatsD backends. Nil when no --statsd.relay-address was configured.
+	relay *Relay
+}
+
+// shardFor returns the shard index metricName is owned by. Hashing on the
+// metric name (rather than, say, round-robin) means every event for a
+// given series always lands on the same worker/shard.
+func (b *Exporter) shardFor(metricName string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(metricName))
+	return int(h.Sum32() % uint32(len(b.shards)))
 }
 
 // Replace invalid characters in the metric name with "_"
@@ -109,43 +137,156 @@ func escapeMetricName(metricName string) string {
 	return sb.String()
 }
 
-// Listen handles all events sent to the given channel sequentially. It
-// terminates when the channel is closed.
+// dispatchedEvent pairs an Event with the mapping already resolved for it,
+// so that shard dispatch can hash on the series name the event will
+// actually be recorded under, and handleEvent doesn't have to repeat the
+// (cached, but not free) mapper lookup.
+type dispatchedEvent struct {
+	event   Event
+	mapping *mapper.MetricMapping
+	labels  map[string]string
+	present bool
+}
+
+// seriesName returns the Prometheus series name de.event will be recorded
+// under. Dispatch must hash on this, not the raw StatsD metric name: a glob
+// mapping can collapse several raw names onto one resolved name, and the
+// shared vecs plus per-series TTL/set/service-check bookkeeping are all
+// keyed on the resolved name. Hashing on the raw name instead would split
+// that state across shards for such collapsed names.
+func seriesName(de dispatchedEvent) string {
+	switch de.event.(type) {
+	case *EventEvent:
+		if de.present {
+			return escapeMetricName(de.mapping.Name)
+		}
+		return "statsd_events_total"
+	case *ServiceCheckEvent:
+		if de.present {
+			return escapeMetricName(de.mapping.Name)
+		}
+		return "statsd_service_check_status"
+	default:
+		if de.present {
+			return escapeMetricName(de.mapping.Name)
+		}
+		return escapeMetricName(de.event.MetricName())
+	}
+}
+
+// eventQueueSize bounds how many events may be queued per worker before
+// Listen blocks handing off more work to it.
+const eventQueueSize = 1000
+
+// relayFlushInterval bounds how long a low-rate metric can sit in a relay
+// destination's batch buffer before it is forwarded, independent of
+// whether the buffer has filled.
+const relayFlushInterval = time.Second
+
+// Listen fans events out across a pool of workers, one per registry shard,
+// so that updating counters/gauges/histograms for unrelated metric series
+// can happen concurrently on multiple cores. Events for the same metric
+// name always land on the same worker, so updates to a given series are
+// never reordered. It terminates when the channel is closed.
 func (b *Exporter) Listen(e <-chan Events) {
 	removeStaleMetricsTicker := clock.NewTicker(time.Second)
+	flushSetsTicker := clock.NewTicker(time.Second)
+	relayFlushTicker := clock.NewTicker(relayFlushInterval)
+
+	queues := make([]chan dispatchedEvent, len(b.shards))
+	var workers sync.WaitGroup
+	for i := range b.shards {
+		queues[i] = make(chan dispatchedEvent, eventQueueSize)
+		workers.Add(1)
+		go b.runWorker(b.shards[i], queues[i], &workers)
+	}
 
 	for {
 		select {
 		case <-removeStaleMetricsTicker.C:
-			b.registry.removeStaleMetrics()
+			for _, shard := range b.shards {
+				shard.removeStaleMetrics()
+			}
+		case <-flushSetsTicker.C:
+			for _, shard := range b.shards {
+				shard.flushSets()
+			}
+		case <-relayFlushTicker.C:
+			if b.relay != nil {
+				b.relay.Flush()
+			}
 		case events, ok := <-e:
 			if !ok {
 				level.Debug(b.logger).Log("msg", "Channel is closed. Break out of Exporter.Listener.")
 				removeStaleMetricsTicker.Stop()
+				flushSetsTicker.Stop()
+				relayFlushTicker.Stop()
+				for _, q := range queues {
+					close(q)
+				}
+				workers.Wait()
+				if b.relay != nil {
+					b.relay.Flush()
+				}
 				return
 			}
 			for _, event := range events {
-				b.handleEvent(event)
+				mapping, labels, present := b.lookupMapping(event.MetricName(), event.MetricType())
+				if mapping == nil {
+					mapping = &mapper.MetricMapping{}
+					if b.mapper.Defaults.Ttl != 0 {
+						mapping.Ttl = b.mapper.Defaults.Ttl
+					}
+				}
+				de := dispatchedEvent{event: event, mapping: mapping, labels: labels, present: present}
+				queues[b.shardFor(seriesName(de))] <- de
 			}
 		}
 	}
 }
 
-// handleEvent processes a single Event according to the configured mapping.
-func (b *Exporter) handleEvent(event Event) {
-	mapping, labels, present := b.mapper.GetMapping(event.MetricName(), event.MetricType())
-	if mapping == nil {
-		mapping = &mapper.MetricMapping{}
-		if b.mapper.Defaults.Ttl != 0 {
-			mapping.Ttl = b.mapper.Defaults.Ttl
-		}
+// runWorker drains queue, applying each event to shard, until queue is
+// closed.
+func (b *Exporter) runWorker(shard *registry, queue <-chan dispatchedEvent, workers *sync.WaitGroup) {
+	defer workers.Done()
+	for de := range queue {
+		b.handleEvent(shard, de)
+	}
+}
+
+// lookupMapping resolves metricName/metricType to a mapping, consulting
+// the mapper cache before falling back to the (comparatively expensive)
+// glob/regex matching in mapper.MetricMapper.GetMapping.
+func (b *Exporter) lookupMapping(metricName string, metricType mapper.MetricType) (*mapper.MetricMapping, map[string]string, bool) {
+	key := mappingCacheKey{metricName: metricName, metricType: metricType}
+	if cached, ok := b.cache.get(key); ok {
+		return cached.mapping, cached.labels, cached.present
 	}
 
+	mapping, labels, present := b.mapper.GetMapping(metricName, metricType)
+	b.cache.put(key, mappingCacheValue{mapping: mapping, labels: labels, present: present})
+	return mapping, labels, present
+}
+
+// handleEvent processes a single dispatched Event according to its already
+// resolved mapping, updating the shared collectors through shard.
+func (b *Exporter) handleEvent(shard *registry, de dispatchedEvent) {
+	event := de.event
+	mapping := de.mapping
+	labels := de.labels
+	present := de.present
+
 	if mapping.Action == mapper.ActionTypeDrop {
 		eventsActions.WithLabelValues("drop").Inc()
 		return
 	}
 
+	if b.relay != nil {
+		if line, ok := relayLine(event); ok {
+			b.relay.Send(line)
+		}
+	}
+
 	help := defaultHelp
 	if mapping.HelpText != "" {
 		help = mapping.HelpText
@@ -179,7 +320,7 @@ func (b *Exporter) handleEvent(event Event) {
 			return
 		}
 
-		counter, err := b.registry.getCounter(metricName, prometheusLabels, help, mapping)
+		counter, err := shard.getCounter(metricName, prometheusLabels, help, mapping)
 		if err == nil {
 			counter.Add(event.Value())
 			eventStats.WithLabelValues("counter").Inc()
@@ -189,7 +330,7 @@ func (b *Exporter) handleEvent(event Event) {
 		}
 
 	case *GaugeEvent:
-		gauge, err := b.registry.getGauge(metricName, prometheusLabels, help, mapping)
+		gauge, err := shard.getGauge(metricName, prometheusLabels, help, mapping)
 
 		if err == nil {
 			if ev.relative {
@@ -203,6 +344,63 @@ func (b *Exporter) handleEvent(event Event) {
 			conflictingEventStats.WithLabelValues("gauge").Inc()
 		}
 
+	case *EventEvent:
+		// Don't fold event.Labels() in here: DogStatsD events carry
+		// arbitrary #tags and an optional hostname that vary from one
+		// event to the next, but vecRegistry.counter fixes a CounterVec's
+		// label names from the first event it sees, so a later event with
+		// a different tag set would fail GetMetricWith and be silently
+		// dropped. Keep this counter's label set to the fields we always
+		// set ourselves.
+		name := "statsd_events_total"
+		if present {
+			name = metricName
+		}
+		eventLabels := prometheus.Labels{
+			"alert_type": ev.alertType,
+			"priority":   ev.priority,
+			"source":     ev.source,
+		}
+		counter, err := shard.getCounter(name, eventLabels, "Total number of DogStatsD events received.", mapping)
+		if err == nil {
+			counter.Add(1)
+			eventStats.WithLabelValues("event").Inc()
+		} else {
+			level.Debug(b.logger).Log("msg", regErrF, "metric", name, "error", err)
+			conflictingEventStats.WithLabelValues("event").Inc()
+		}
+
+	case *ServiceCheckEvent:
+		statusName := "statsd_service_check_status"
+		transitionsName := "statsd_service_check_status_transitions_total"
+		if present {
+			statusName = metricName
+			transitionsName = metricName + "_transitions_total"
+		}
+		gauge, err := shard.getGauge(statusName, prometheusLabels, "Status of the most recent DogStatsD service check (0=ok, 1=warning, 2=critical, 3=unknown).", mapping)
+		if err == nil {
+			gauge.Set(ev.status)
+			eventStats.WithLabelValues("service_check").Inc()
+		} else {
+			level.Debug(b.logger).Log("msg", regErrF, "metric", statusName, "error", err)
+			conflictingEventStats.WithLabelValues("service_check").Inc()
+		}
+
+		if shard.serviceCheckTransitioned(statusName, prometheusLabels, ev.status) {
+			transitions, err := shard.getCounter(transitionsName, prometheusLabels, "Total number of DogStatsD service check status transitions.", mapping)
+			if err == nil {
+				transitions.Add(1)
+			}
+		}
+
+	case *SetEvent:
+		if err := shard.observeSet(metricName, prometheusLabels, help, mapping, ev.SetValue()); err == nil {
+			eventStats.WithLabelValues("set").Inc()
+		} else {
+			level.Debug(b.logger).Log("msg", regErrF, "metric", metricName, "error", err)
+			conflictingEventStats.WithLabelValues("set").Inc()
+		}
+
 	case *TimerEvent:
 		t := mapper.TimerTypeDefault
 		if mapping != nil {
@@ -214,7 +412,7 @@ func (b *Exporter) handleEvent(event Event) {
 
 		switch t {
 		case mapper.TimerTypeHistogram:
-			histogram, err := b.registry.getHistogram(metricName, prometheusLabels, help, mapping)
+			histogram, err := shard.getHistogram(metricName, prometheusLabels, help, mapping)
 			if err == nil {
 				histogram.Observe(event.Value() / 1000) // prometheus presumes seconds, statsd millisecond
 				eventStats.WithLabelValues("timer").Inc()
@@ -224,7 +422,7 @@ func (b *Exporter) handleEvent(event Event) {
 			}
 
 		case mapper.TimerTypeDefault, mapper.TimerTypeSummary:
-			summary, err := b.registry.getSummary(metricName, prometheusLabels, help, mapping)
+			summary, err := shard.getSummary(metricName, prometheusLabels, help, mapping)
 			if err == nil {
 				summary.Observe(event.Value() / 1000) // prometheus presumes seconds, statsd millisecond
 				eventStats.WithLabelValues("timer").Inc()
@@ -244,14 +442,62 @@ func (b *Exporter) handleEvent(event Event) {
 	}
 }
 
-func NewExporter(mapper *mapper.MetricMapper, logger log.Logger) *Exporter {
+// NewExporter builds an Exporter with shardCount independent registry
+// shards. A shardCount <= 0 defaults to runtime.GOMAXPROCS(0), so that by
+// default there's one shard (and, once Listen is running, one worker) per
+// available core.
+func NewExporter(mapper *mapper.MetricMapper, logger log.Logger, cacheType CacheType, cacheSize int, shardCount int, relayAddresses []string, relayMaxPacketSize int) *Exporter {
+	if shardCount <= 0 {
+		shardCount = runtime.GOMAXPROCS(0)
+	}
+	vecs := newVecRegistry()
+	shards := make([]*registry, shardCount)
+	for i := range shards {
+		shards[i] = newRegistry(mapper, logger, vecs)
+	}
+
+	var relay *Relay
+	if len(relayAddresses) > 0 {
+		var err error
+		relay, err = NewRelay(relayAddresses, relayMaxPacketSize, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to set up StatsD relay", "error", err)
+			relay = nil
+		}
+	}
+
 	return &Exporter{
-		mapper:   mapper,
-		registry: newRegistry(mapper),
-		logger:   logger,
+		mapper: mapper,
+		vecs:   vecs,
+		shards: shards,
+		cache:  newMappingCache(cacheType, cacheSize),
+		logger: logger,
+		relay:  relay,
 	}
 }
 
+// SetMapper replaces the mapper config on a reload, invalidating any
+// cached GetMapping results from the old config.
+func (b *Exporter) SetMapper(m *mapper.MetricMapper) {
+	b.mapper = m
+	for _, shard := range b.shards {
+		shard.mapper = m
+	}
+	b.cache.reset()
+}
+
+// Describe implements prometheus.Collector. Collectors created on the fly
+// are unchecked, so Describe intentionally yields nothing; see
+// uncheckedCollector.
+func (b *Exporter) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector. The underlying vectors are
+// shared across every shard (see vecRegistry), so there is exactly one
+// collector per metric name to fan out to, regardless of shard count.
+func (b *Exporter) Collect(ch chan<- prometheus.Metric) {
+	b.vecs.Collect(ch)
+}
+
 func buildEvent(statType, metric string, value float64, relative bool, labels map[string]string) (Event, error) {
 	switch statType {
 	case "c":
@@ -274,7 +520,9 @@ func buildEvent(statType, metric string, value float64, relative bool, labels ma
 			labels:     labels,
 		}, nil
 	case "s":
-		return nil, fmt.Errorf("no support for StatsD sets")
+		// Sets carry a string member rather than a numeric value and are
+		// handled directly in lineToEvents before buildEvent is reached.
+		return nil, fmt.Errorf("StatsD sets must be parsed before buildEvent")
 	default:
 		return nil, fmt.Errorf("bad stat type %s", statType)
 	}
@@ -364,12 +612,121 @@ func parseNameAndTags(name string, labels map[string]string, logger log.Logger)
 	return name
 }
 
+// parseDogStatsDEvent parses a DogStatsD event line of the form
+// `_e{title_len,text_len}:title|text|d:timestamp|h:hostname|p:priority|t:alert_type|#tag1,tag2`.
+func parseDogStatsDEvent(line string, logger log.Logger) (Event, error) {
+	rest := strings.TrimPrefix(line, "_e{")
+	lengths := strings.SplitN(rest, "}:", 2)
+	if len(lengths) != 2 {
+		return nil, fmt.Errorf("malformed DogStatsD event header")
+	}
+	sizes := strings.SplitN(lengths[0], ",", 2)
+	if len(sizes) != 2 {
+		return nil, fmt.Errorf("malformed DogStatsD event header")
+	}
+	titleLen, err := strconv.Atoi(sizes[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed DogStatsD event title length: %w", err)
+	}
+	textLen, err := strconv.Atoi(sizes[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed DogStatsD event text length: %w", err)
+	}
+	if titleLen < 0 || textLen < 0 {
+		return nil, fmt.Errorf("malformed DogStatsD event header: negative length")
+	}
+	if len(lengths[1]) < titleLen+1+textLen {
+		return nil, fmt.Errorf("DogStatsD event body shorter than declared lengths")
+	}
+
+	ev := &EventEvent{
+		metricName: "events",
+		title:      lengths[1][:titleLen],
+		text:       lengths[1][titleLen+1 : titleLen+1+textLen],
+		alertType:  "info",
+		labels:     map[string]string{},
+	}
+
+	for _, field := range strings.Split(lengths[1][titleLen+1+textLen:], "|") {
+		if field == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(field, "h:"):
+			ev.labels["hostname"] = field[2:]
+		case strings.HasPrefix(field, "p:"):
+			ev.priority = field[2:]
+		case strings.HasPrefix(field, "t:"):
+			ev.alertType = field[2:]
+		case strings.HasPrefix(field, "s:"):
+			ev.source = field[2:]
+		case strings.HasPrefix(field, "#"):
+			parseDogStatsDTags(field[1:], ev.labels, logger)
+		}
+	}
+
+	return ev, nil
+}
+
+// parseDogStatsDServiceCheck parses a DogStatsD service check line of the
+// form `_sc|name|status|d:timestamp|h:hostname|#tag1,tag2|m:message`.
+func parseDogStatsDServiceCheck(line string, logger log.Logger) (Event, error) {
+	fields := strings.Split(line, "|")
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("malformed DogStatsD service check")
+	}
+	status, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed DogStatsD service check status: %w", err)
+	}
+
+	sc := &ServiceCheckEvent{
+		metricName: fields[1],
+		status:     status,
+		labels:     map[string]string{"name": fields[1]},
+	}
+
+	for _, field := range fields[3:] {
+		switch {
+		case strings.HasPrefix(field, "h:"):
+			sc.labels["hostname"] = field[2:]
+		case strings.HasPrefix(field, "m:"):
+			sc.message = field[2:]
+		case strings.HasPrefix(field, "#"):
+			parseDogStatsDTags(field[1:], sc.labels, logger)
+		}
+	}
+
+	return sc, nil
+}
+
 func lineToEvents(line string, logger log.Logger) Events {
 	events := Events{}
 	if line == "" {
 		return events
 	}
 
+	if strings.HasPrefix(line, "_e{") {
+		samplesReceived.Inc()
+		event, err := parseDogStatsDEvent(line, logger)
+		if err != nil {
+			level.Debug(logger).Log("msg", "Error parsing DogStatsD event", "line", line, "error", err)
+			sampleErrors.WithLabelValues("illegal_event").Inc()
+			return events
+		}
+		return append(events, event)
+	}
+	if strings.HasPrefix(line, "_sc|") {
+		samplesReceived.Inc()
+		event, err := parseDogStatsDServiceCheck(line, logger)
+		if err != nil {
+			level.Debug(logger).Log("msg", "Error parsing DogStatsD service check", "line", line, "error", err)
+			sampleErrors.WithLabelValues("illegal_event").Inc()
+			return events
+		}
+		return append(events, event)
+	}
+
 	elements := strings.SplitN(line, ":", 2)
 	if len(elements) < 2 || len(elements[0]) == 0 || !utf8.ValidString(line) {
 		sampleErrors.WithLabelValues("malformed_line").Inc()
@@ -408,6 +765,19 @@ samples:
 		}
 		valueStr, statType := components[0], components[1]
 
+		if statType == "s" {
+			for _, component := range components[2:] {
+				if len(component) > 0 && component[0] == '#' {
+					parseDogStatsDTags(component[1:], labels, logger)
+				}
+			}
+			if len(labels) > 0 {
+				tagsReceived.Inc()
+			}
+			events = append(events, &SetEvent{metricName: metric, value: valueStr, labels: labels})
+			continue
+		}
+
 		var relative = false
 		if strings.Index(valueStr, "+") == 0 || strings.Index(valueStr, "-") == 0 {
 			relative = true
@@ -478,9 +848,10 @@ samples:
 }
 
 type StatsDUDPListener struct {
-	conn         *net.UDPConn
-	eventHandler eventHandler
-	logger       log.Logger
+	conn           *net.UDPConn
+	eventHandler   eventHandler
+	logger         log.Logger
+	recvBufferSize int
 }
 
 func (l *StatsDUDPListener) SetEventHandler(eh eventHandler) {
@@ -488,7 +859,11 @@ func (l *StatsDUDPListener) SetEventHandler(eh eventHandler) {
 }
 
 func (l *StatsDUDPListener) Listen() {
-	buf := make([]byte, 65535)
+	bufSize := l.recvBufferSize
+	if bufSize <= 0 {
+		bufSize = defaultRecvBufferSize
+	}
+	buf := make([]byte, bufSize)
 	for {
 		n, _, err := l.conn.ReadFromUDP(buf)
 		if err != nil {
@@ -565,9 +940,10 @@ func (l *StatsDTCPListener) handleConn(c *net.TCPConn) {
 }
 
 type StatsDUnixgramListener struct {
-	conn         *net.UnixConn
-	eventHandler eventHandler
-	logger       log.Logger
+	conn           *net.UnixConn
+	eventHandler   eventHandler
+	logger         log.Logger
+	recvBufferSize int
 }
 
 func (l *StatsDUnixgramListener) SetEventHandler(eh eventHandler) {
@@ -575,7 +951,11 @@ func (l *StatsDUnixgramListener) SetEventHandler(eh eventHandler) {
 }
 
 func (l *StatsDUnixgramListener) Listen() {
-	buf := make([]byte, 65535)
+	bufSize := l.recvBufferSize
+	if bufSize <= 0 {
+		bufSize = defaultRecvBufferSize
+	}
+	buf := make([]byte, bufSize)
 	for {
 		n, _, err := l.conn.ReadFromUnix(buf)
 		if err != nil {
@@ -0,0 +1,83 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kit/kit/log"
+)
+
+// defaultRecvBufferSize is used when a listener isn't given an explicit
+// per-shard receive-buffer size.
+const defaultRecvBufferSize = 65535
+
+// NewStatsDUDPListener binds a UDP socket at address. When reusePort is
+// true (Linux only), SO_REUSEPORT lets several of these be bound to the
+// same address, each feeding its own parse-dispatch pipeline.
+func NewStatsDUDPListener(address string, reusePort bool, recvBufferSize int, eventHandler eventHandler, logger log.Logger) (*StatsDUDPListener, error) {
+	if reusePort {
+		warnReusePortUnsupported(logger)
+	}
+	lc := net.ListenConfig{Control: controlReusePort(reusePort)}
+	pc, err := lc.ListenPacket(context.Background(), "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if recvBufferSize <= 0 {
+		recvBufferSize = defaultRecvBufferSize
+	}
+	return &StatsDUDPListener{
+		conn:           pc.(*net.UDPConn),
+		eventHandler:   eventHandler,
+		logger:         logger,
+		recvBufferSize: recvBufferSize,
+	}, nil
+}
+
+// NewStatsDTCPListener binds a TCP socket at address, with the same
+// SO_REUSEPORT behavior as NewStatsDUDPListener.
+func NewStatsDTCPListener(address string, reusePort bool, eventHandler eventHandler, logger log.Logger) (*StatsDTCPListener, error) {
+	if reusePort {
+		warnReusePortUnsupported(logger)
+	}
+	lc := net.ListenConfig{Control: controlReusePort(reusePort)}
+	l, err := lc.Listen(context.Background(), "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDTCPListener{
+		conn:         l.(*net.TCPListener),
+		eventHandler: eventHandler,
+		logger:       logger,
+	}, nil
+}
+
+// NewStatsDUnixgramListener binds a Unix datagram socket at path.
+func NewStatsDUnixgramListener(path string, recvBufferSize int, eventHandler eventHandler, logger log.Logger) (*StatsDUnixgramListener, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	if recvBufferSize <= 0 {
+		recvBufferSize = defaultRecvBufferSize
+	}
+	return &StatsDUnixgramListener{
+		conn:           conn,
+		eventHandler:   eventHandler,
+		logger:         logger,
+		recvBufferSize: recvBufferSize,
+	}, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	eventStats = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "statsd_exporter_events_total",
+		Help: "The total number of StatsD events seen, by type.",
+	}, []string{"type"})
+
+	eventsActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "statsd_exporter_events_actions_total",
+		Help: "The total number of StatsD events by action.",
+	}, []string{"action"})
+
+	eventsUnmapped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_events_unmapped_total",
+		Help: "The total number of StatsD events no mapping was found for.",
+	})
+
+	errorEventStats = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "statsd_exporter_events_error_total",
+		Help: "The total number of StatsD events discarded due to errors, by type.",
+	}, []string{"reason"})
+
+	conflictingEventStats = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "statsd_exporter_events_conflict_total",
+		Help: "The total number of StatsD events discarded due to metric definition conflicts, by type.",
+	}, []string{"type"})
+
+	sampleErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "statsd_exporter_sample_errors_total",
+		Help: "The total number of errors parsing StatsD samples, by reason.",
+	}, []string{"reason"})
+
+	samplesReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_samples_total",
+		Help: "The total number of StatsD samples received.",
+	})
+
+	tagsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_tags_total",
+		Help: "The total number of StatsD samples received with tags.",
+	})
+
+	tagErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_tag_errors_total",
+		Help: "The number of errors parsing StatsD tags.",
+	})
+
+	udpPackets = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_udp_packets_total",
+		Help: "The total number of StatsD packets received over UDP.",
+	})
+
+	tcpConnections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_tcp_connections_total",
+		Help: "The total number of TCP connections handled.",
+	})
+
+	tcpErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_tcp_connection_errors_total",
+		Help: "The number of errors encountered reading from TCP.",
+	})
+
+	tcpLineTooLong = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_tcp_too_long_lines_total",
+		Help: "The number of lines discarded due to being too long.",
+	})
+
+	unixgramPackets = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_unixgram_packets_total",
+		Help: "The total number of StatsD packets received over Unixgram.",
+	})
+
+	linesReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_lines_total",
+		Help: "The total number of StatsD lines received.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(eventStats, eventsActions, eventsUnmapped, errorEventStats,
+		conflictingEventStats, sampleErrors, samplesReceived, tagsReceived, tagErrors,
+		udpPackets, tcpConnections, tcpErrors, tcpLineTooLong, unixgramPackets, linesReceived)
+}
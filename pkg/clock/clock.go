@@ -0,0 +1,37 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clock wraps time.Ticker for the exporter's periodic tasks. The
+// wrapper is always backed by a real time.Ticker; it has no fake
+// implementation.
+package clock
+
+import "time"
+
+// Ticker mirrors the subset of time.Ticker the exporter depends on.
+type Ticker struct {
+	C <-chan time.Time
+
+	t *time.Ticker
+}
+
+// NewTicker returns a Ticker backed by time.NewTicker.
+func NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, t: t}
+}
+
+// Stop turns off the ticker.
+func (t *Ticker) Stop() {
+	t.t.Stop()
+}
@@ -0,0 +1,136 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// ActionType controls what the exporter does with an event once it has
+// matched a mapping rule.
+type ActionType string
+
+const (
+	ActionTypeMap  ActionType = "map"
+	ActionTypeDrop ActionType = "drop"
+)
+
+// TimerType selects which Prometheus metric type a StatsD timer is
+// reported as.
+type TimerType string
+
+const (
+	TimerTypeDefault   TimerType = ""
+	TimerTypeHistogram TimerType = "histogram"
+	TimerTypeSummary   TimerType = "summary"
+)
+
+// MetricMapping is a single rule from the mapper YAML config, matching one
+// or more StatsD metric names and describing how to turn them into
+// Prometheus metrics.
+type MetricMapping struct {
+	// Match is a shell glob pattern (as accepted by path/filepath.Match:
+	// "*", "?" and "[...]" classes) matched against the full StatsD metric
+	// name.
+	Match           string            `yaml:"match"`
+	MatchMetricType MetricType        `yaml:"match_metric_type"`
+	Name            string            `yaml:"name"`
+	Action          ActionType        `yaml:"action"`
+	HelpText        string            `yaml:"help"`
+	Labels          map[string]string `yaml:"labels"`
+	Ttl             time.Duration     `yaml:"ttl"`
+	TimerType       TimerType         `yaml:"timer_type"`
+
+	// Deprecated: use SummaryOptions.Quantiles instead.
+	Quantiles []MetricObjective `yaml:"quantiles"`
+	// Deprecated: use HistogramOptions.Buckets instead.
+	Buckets []float64 `yaml:"buckets"`
+
+	SummaryOptions   *SummaryOptions   `yaml:"summary_options"`
+	HistogramOptions *HistogramOptions `yaml:"histogram_options"`
+
+	// ExactSet selects the exact (unbounded memory) set tracker instead of
+	// the default HyperLogLog sketch.
+	ExactSet bool `yaml:"exact_set"`
+	// SetFlushInterval overrides MapperConfigDefaults.SetFlushInterval for
+	// this mapping.
+	SetFlushInterval time.Duration `yaml:"set_flush_interval"`
+}
+
+// MetricObjective is a single quantile/error-margin pair, as accepted by
+// prometheus.SummaryOpts.Objectives.
+type MetricObjective struct {
+	Quantile float64 `yaml:"quantile"`
+	Error    float64 `yaml:"error"`
+}
+
+// SummaryOptions configures the decay behavior of a summary metric,
+// mirroring prometheus.SummaryOpts. Zero values fall back to the
+// prometheus client's own defaults.
+type SummaryOptions struct {
+	Quantiles        []MetricObjective `yaml:"quantiles"`
+	MaxAge           time.Duration     `yaml:"max_summary_age"`
+	AgeBuckets       uint32            `yaml:"summary_age_buckets"`
+	StreamBufferSize uint32            `yaml:"stream_buffer_size"`
+}
+
+// HistogramOptions configures bucket boundaries and native histogram
+// behavior, mirroring prometheus.HistogramOpts.
+type HistogramOptions struct {
+	Buckets                     []float64 `yaml:"buckets"`
+	NativeHistogramBucketFactor float64   `yaml:"native_histogram_bucket_factor"`
+	NativeHistogramMaxBuckets   uint32    `yaml:"native_histogram_max_bucket_number"`
+}
+
+// MapperConfigDefaults holds fallback values applied when a mapping (or
+// the absence of one) doesn't specify its own.
+type MapperConfigDefaults struct {
+	Ttl              time.Duration `yaml:"ttl"`
+	TimerType        TimerType     `yaml:"timer_type"`
+	SetFlushInterval time.Duration `yaml:"set_flush_interval"`
+}
+
+// MetricMapper turns StatsD metric names into Prometheus metric mappings
+// using a set of match rules loaded from YAML.
+type MetricMapper struct {
+	Defaults MapperConfigDefaults `yaml:"defaults"`
+	Mappings []MetricMapping      `yaml:"mappings"`
+}
+
+// GetMapping finds the first mapping rule whose match glob and
+// match_metric_type (if any) apply to metricName/metricType, returning a
+// copy of that rule's static Labels (the "labels:" block in its config
+// entry) to merge onto the resulting series. present is false when no rule
+// matched. filepath.Match globs don't support capturing named groups from
+// the pattern itself, so only this static label set is returned. A
+// malformed glob pattern is treated as a non-match rather than an error.
+func (m *MetricMapper) GetMapping(metricName string, metricType MetricType) (*MetricMapping, map[string]string, bool) {
+	for i := range m.Mappings {
+		mapping := &m.Mappings[i]
+		if mapping.MatchMetricType != "" && mapping.MatchMetricType != metricType {
+			continue
+		}
+		matched, err := filepath.Match(mapping.Match, metricName)
+		if err != nil || !matched {
+			continue
+		}
+		labels := make(map[string]string, len(mapping.Labels))
+		for k, v := range mapping.Labels {
+			labels[k] = v
+		}
+		return mapping, labels, true
+	}
+	return nil, map[string]string{}, false
+}
@@ -0,0 +1,26 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+// MetricType identifies the kind of StatsD line a mapping rule applies to.
+type MetricType string
+
+const (
+	MetricTypeCounter      MetricType = "counter"
+	MetricTypeGauge        MetricType = "gauge"
+	MetricTypeTimer        MetricType = "timer"
+	MetricTypeEvent        MetricType = "event"
+	MetricTypeServiceCheck MetricType = "service_check"
+	MetricTypeSet          MetricType = "set"
+)
@@ -0,0 +1,57 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sets
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLogCountAccuracy(t *testing.T) {
+	const n = 100000
+	h := NewHyperLogLog(DefaultPrecision)
+	for i := 0; i < n; i++ {
+		h.Add(fmt.Sprintf("member-%d", i))
+	}
+
+	got := float64(h.Count())
+	wantErr := 0.02 // generous bound around the ~0.8% standard error at this precision
+	if errRatio := math.Abs(got-n) / n; errRatio > wantErr {
+		t.Errorf("Count() = %v, want within %.0f%% of %d (off by %.2f%%)", got, wantErr*100, n, errRatio*100)
+	}
+}
+
+func TestHyperLogLogCountDuplicatesDontInflate(t *testing.T) {
+	h := NewHyperLogLog(DefaultPrecision)
+	for i := 0; i < 1000; i++ {
+		h.Add("same-member")
+	}
+
+	if got := h.Count(); got > 5 {
+		t.Errorf("Count() = %d, want close to 1 for a single repeated member", got)
+	}
+}
+
+func TestHyperLogLogReset(t *testing.T) {
+	h := NewHyperLogLog(DefaultPrecision)
+	for i := 0; i < 1000; i++ {
+		h.Add(fmt.Sprintf("member-%d", i))
+	}
+	h.Reset()
+
+	if got := h.Count(); got > 5 {
+		t.Errorf("Count() after Reset() = %d, want close to 0", got)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sets
+
+// Tracker maintains the set of distinct values observed for a single
+// StatsD set metric within a flush window.
+type Tracker interface {
+	Add(value string)
+	Count() uint64
+	Reset()
+}
+
+// ExactSet is a Tracker backed by a Go map, giving an exact distinct count
+// at the cost of unbounded memory growth with the number of distinct
+// values.
+type ExactSet struct {
+	values map[string]struct{}
+}
+
+// NewExactSet returns an empty ExactSet.
+func NewExactSet() *ExactSet {
+	return &ExactSet{values: map[string]struct{}{}}
+}
+
+func (s *ExactSet) Add(value string) {
+	s.values[value] = struct{}{}
+}
+
+func (s *ExactSet) Count() uint64 {
+	return uint64(len(s.values))
+}
+
+func (s *ExactSet) Reset() {
+	s.values = map[string]struct{}{}
+}
+
+// NewTracker returns an ExactSet, or a bounded-memory HyperLogLog sketch
+// when exact is false.
+func NewTracker(exact bool) Tracker {
+	if exact {
+		return NewExactSet()
+	}
+	return NewHyperLogLog(DefaultPrecision)
+}
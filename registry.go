@@ -0,0 +1,427 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"kubevault.dev/vault_exporter/pkg/mapper"
+	"kubevault.dev/vault_exporter/pkg/sets"
+)
+
+// defaultSetFlushInterval is used when neither a mapping nor the mapper
+// defaults specify set_flush_interval.
+const defaultSetFlushInterval = time.Minute
+
+// vecDeleter is the subset of the various *prometheus.*Vec types needed to
+// drop a single series by its label values. All of counters/gauges/
+// summaries/histograms/setGauges satisfy it.
+type vecDeleter interface {
+	Delete(prometheus.Labels) bool
+}
+
+// registeredMetric tracks a single Prometheus series along with the
+// bookkeeping needed to expire it once it has been idle for longer than
+// its mapping's TTL.
+type registeredMetric struct {
+	lastRegisteredAt time.Time
+	ttl              time.Duration
+	vec              vecDeleter
+	labels           prometheus.Labels
+}
+
+// vecRegistry owns every Prometheus collector the exporter has created on
+// the fly in response to incoming StatsD events, keyed only by the
+// resolved Prometheus metric name. It is shared by every registry shard so
+// that two shards updating the same metric name always write into, and
+// collect from, the very same vector - a metric name can only ever have one
+// label-name set, exactly as a single (unsharded) registry would enforce.
+type vecRegistry struct {
+	mu sync.Mutex
+
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]*prometheus.GaugeVec
+	summaries  map[string]*prometheus.SummaryVec
+	histograms map[string]*prometheus.HistogramVec
+	setGauges  map[string]*prometheus.GaugeVec
+}
+
+func newVecRegistry() *vecRegistry {
+	return &vecRegistry{
+		counters:   map[string]*prometheus.CounterVec{},
+		gauges:     map[string]*prometheus.GaugeVec{},
+		summaries:  map[string]*prometheus.SummaryVec{},
+		histograms: map[string]*prometheus.HistogramVec{},
+		setGauges:  map[string]*prometheus.GaugeVec{},
+	}
+}
+
+func (v *vecRegistry) counter(metricName, help string, labels prometheus.Labels) *prometheus.CounterVec {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	vec, ok := v.counters[metricName]
+	if !ok {
+		vec = prometheus.NewCounterVec(prometheus.CounterOpts{Name: metricName, Help: help}, labelNames(labels))
+		v.counters[metricName] = vec
+	}
+	return vec
+}
+
+func (v *vecRegistry) gauge(metricName, help string, labels prometheus.Labels) *prometheus.GaugeVec {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	vec, ok := v.gauges[metricName]
+	if !ok {
+		vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: metricName, Help: help}, labelNames(labels))
+		v.gauges[metricName] = vec
+	}
+	return vec
+}
+
+func (v *vecRegistry) summary(metricName string, opts prometheus.SummaryOpts, labels prometheus.Labels) *prometheus.SummaryVec {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	vec, ok := v.summaries[metricName]
+	if !ok {
+		vec = prometheus.NewSummaryVec(opts, labelNames(labels))
+		v.summaries[metricName] = vec
+	}
+	return vec
+}
+
+func (v *vecRegistry) histogram(metricName string, opts prometheus.HistogramOpts, labels prometheus.Labels) *prometheus.HistogramVec {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	vec, ok := v.histograms[metricName]
+	if !ok {
+		vec = prometheus.NewHistogramVec(opts, labelNames(labels))
+		v.histograms[metricName] = vec
+	}
+	return vec
+}
+
+func (v *vecRegistry) setGauge(gaugeName, help string, labels prometheus.Labels) *prometheus.GaugeVec {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	vec, ok := v.setGauges[gaugeName]
+	if !ok {
+		vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: gaugeName, Help: help}, labelNames(labels))
+		v.setGauges[gaugeName] = vec
+	}
+	return vec
+}
+
+// Describe implements prometheus.Collector. Collectors created on the fly
+// are unchecked, so Describe intentionally yields nothing.
+func (v *vecRegistry) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector, fanning out to every dynamically
+// registered metric vector.
+func (v *vecRegistry) Collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, vec := range v.counters {
+		vec.Collect(ch)
+	}
+	for _, vec := range v.gauges {
+		vec.Collect(ch)
+	}
+	for _, vec := range v.summaries {
+		vec.Collect(ch)
+	}
+	for _, vec := range v.histograms {
+		vec.Collect(ch)
+	}
+	for _, vec := range v.setGauges {
+		vec.Collect(ch)
+	}
+}
+
+// registry is one shard's view onto the exporter's metrics: it owns the
+// per-series TTL bookkeeping and set-cardinality state for whatever events
+// land on it, but defers to the shared vecs for the actual Prometheus
+// collectors so that every shard agrees on one label-name set per metric
+// name.
+type registry struct {
+	mu      sync.Mutex
+	mapper  *mapper.MetricMapper
+	logger  log.Logger
+	vecs    *vecRegistry
+	metrics map[string]*registeredMetric
+
+	setStates map[string]*setState
+
+	// serviceCheckStatus remembers the last status value seen for a given
+	// (metricName, labels) service check, so transitions can be counted
+	// only when the status actually changes.
+	serviceCheckStatus map[string]float64
+}
+
+// setState tracks the cardinality of a single (metricName, labels) set
+// bucket between flushes.
+type setState struct {
+	tracker       sets.Tracker
+	flushInterval time.Duration
+	lastFlush     time.Time
+	vec           *prometheus.GaugeVec
+	labels        prometheus.Labels
+}
+
+func newRegistry(m *mapper.MetricMapper, logger log.Logger, vecs *vecRegistry) *registry {
+	return &registry{
+		mapper:             m,
+		logger:             logger,
+		vecs:               vecs,
+		metrics:            map[string]*registeredMetric{},
+		setStates:          map[string]*setState{},
+		serviceCheckStatus: map[string]float64{},
+	}
+}
+
+// metricKey returns a stable identity for one real series: the metric name
+// plus its full label signature (names and values). Two series that share a
+// name but differ in even one label value must get distinct keys, or their
+// TTL/set/service-check bookkeeping collapses onto a single entry.
+func metricKey(metricName string, labels prometheus.Labels) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, k := range names {
+		pairs[i] = k + "=" + labels[k]
+	}
+	return metricName + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (r *registry) touch(key string, ttl time.Duration, vec vecDeleter, labels prometheus.Labels) {
+	if m, ok := r.metrics[key]; ok {
+		m.lastRegisteredAt = time.Now()
+		return
+	}
+	r.metrics[key] = &registeredMetric{lastRegisteredAt: time.Now(), ttl: ttl, vec: vec, labels: labels}
+}
+
+func (r *registry) getCounter(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping) (prometheus.Counter, error) {
+	vec := r.vecs.counter(metricName, help, labels)
+	c, err := vec.GetMetricWith(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.touch(metricKey(metricName, labels), mapping.Ttl, vec, labels)
+	r.mu.Unlock()
+	return c, nil
+}
+
+func (r *registry) getGauge(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping) (prometheus.Gauge, error) {
+	vec := r.vecs.gauge(metricName, help, labels)
+	g, err := vec.GetMetricWith(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.touch(metricKey(metricName, labels), mapping.Ttl, vec, labels)
+	r.mu.Unlock()
+	return g, nil
+}
+
+func (r *registry) getSummary(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping) (prometheus.Observer, error) {
+	vec := r.vecs.summary(metricName, r.summaryOpts(metricName, help, mapping), labels)
+	s, err := vec.GetMetricWith(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.touch(metricKey(metricName, labels), mapping.Ttl, vec, labels)
+	r.mu.Unlock()
+	return s, nil
+}
+
+func (r *registry) getHistogram(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping) (prometheus.Observer, error) {
+	vec := r.vecs.histogram(metricName, r.histogramOpts(metricName, help, mapping), labels)
+	h, err := vec.GetMetricWith(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.touch(metricKey(metricName, labels), mapping.Ttl, vec, labels)
+	r.mu.Unlock()
+	return h, nil
+}
+
+// observeSet records value as a member of the set identified by
+// metricName/labels, updating the published "<metricName>_unique" gauge
+// with the tracker's current cardinality estimate.
+func (r *registry) observeSet(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping, value string) error {
+	gaugeName := metricName + "_unique"
+	vec := r.vecs.setGauge(gaugeName, help, labels)
+	gauge, err := vec.GetMetricWith(labels)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := metricKey(metricName, labels)
+	state, ok := r.setStates[key]
+	if !ok {
+		flushInterval := mapping.SetFlushInterval
+		if flushInterval == 0 {
+			flushInterval = r.mapper.Defaults.SetFlushInterval
+		}
+		if flushInterval == 0 {
+			flushInterval = defaultSetFlushInterval
+		}
+		state = &setState{
+			tracker:       sets.NewTracker(mapping.ExactSet),
+			flushInterval: flushInterval,
+			lastFlush:     time.Now(),
+			vec:           vec,
+			labels:        labels,
+		}
+		r.setStates[key] = state
+	}
+	state.tracker.Add(value)
+	gauge.Set(float64(state.tracker.Count()))
+
+	r.touch(key, mapping.Ttl, vec, labels)
+	return nil
+}
+
+// serviceCheckTransitioned reports whether status differs from the last
+// status recorded for this (metricName, labels) service check, recording
+// status as the new baseline either way.
+func (r *registry) serviceCheckTransitioned(metricName string, labels prometheus.Labels, status float64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := metricKey(metricName, labels)
+	prev, ok := r.serviceCheckStatus[key]
+	r.serviceCheckStatus[key] = status
+	return ok && prev != status
+}
+
+// flushSets resets any set tracker whose flush interval has elapsed,
+// starting a fresh counting window, and zeroes the published
+// "<name>_unique" gauge so it doesn't keep reporting the pre-flush
+// cardinality until the next observeSet.
+func (r *registry) flushSets() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, state := range r.setStates {
+		if now.Sub(state.lastFlush) >= state.flushInterval {
+			state.tracker.Reset()
+			state.lastFlush = now
+			if gauge, err := state.vec.GetMetricWith(state.labels); err == nil {
+				gauge.Set(0)
+			}
+		}
+	}
+}
+
+func (r *registry) summaryOpts(metricName, help string, mapping *mapper.MetricMapping) prometheus.SummaryOpts {
+	opts := prometheus.SummaryOpts{Name: metricName, Help: help}
+
+	quantiles := mapping.Quantiles
+	if mapping.SummaryOptions != nil {
+		if len(mapping.Quantiles) > 0 {
+			level.Warn(r.logger).Log("msg", "top-level quantiles is deprecated; use summary_options.quantiles instead", "metric", metricName)
+		}
+		quantiles = mapping.SummaryOptions.Quantiles
+		opts.MaxAge = mapping.SummaryOptions.MaxAge
+		opts.AgeBuckets = mapping.SummaryOptions.AgeBuckets
+		opts.BufCap = mapping.SummaryOptions.StreamBufferSize
+	}
+	if len(quantiles) > 0 {
+		objectives := map[float64]float64{}
+		for _, q := range quantiles {
+			objectives[q.Quantile] = q.Error
+		}
+		opts.Objectives = objectives
+	}
+	return opts
+}
+
+func (r *registry) histogramOpts(metricName, help string, mapping *mapper.MetricMapping) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{Name: metricName, Help: help}
+
+	buckets := mapping.Buckets
+	if mapping.HistogramOptions != nil {
+		if len(mapping.Buckets) > 0 {
+			level.Warn(r.logger).Log("msg", "top-level buckets is deprecated; use histogram_options.buckets instead", "metric", metricName)
+		}
+		buckets = mapping.HistogramOptions.Buckets
+		opts.NativeHistogramBucketFactor = mapping.HistogramOptions.NativeHistogramBucketFactor
+		opts.NativeHistogramMaxBucketNumber = mapping.HistogramOptions.NativeHistogramMaxBuckets
+	}
+	if len(buckets) > 0 {
+		opts.Buckets = buckets
+	}
+	return opts
+}
+
+func labelNames(labels prometheus.Labels) []string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// removeStaleMetrics drops any metric whose mapping carries a TTL and
+// which hasn't been touched since that TTL elapsed, deleting the series
+// from its owning vec so it stops being emitted by Collect.
+func (r *registry) removeStaleMetrics() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, m := range r.metrics {
+		if m.ttl == 0 {
+			continue
+		}
+		if now.Sub(m.lastRegisteredAt) > m.ttl {
+			m.vec.Delete(m.labels)
+			delete(r.metrics, key)
+			delete(r.setStates, key)
+		}
+	}
+}
+
+var errMetricConflict = fmt.Errorf("metric already registered with a different type")
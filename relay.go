@@ -0,0 +1,191 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultRelayMaxPacketSize caps batched UDP datagrams at the common
+// Ethernet MTU (1500) minus typical IP/UDP header overhead.
+const defaultRelayMaxPacketSize = 1432
+
+var (
+	relayLinesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_relay_lines_total",
+		Help: "The total number of StatsD lines forwarded to relay destinations.",
+	})
+
+	relayPacketsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_relay_packets_total",
+		Help: "The total number of UDP datagrams sent to relay destinations.",
+	})
+
+	relayPacketBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "statsd_exporter_relay_packet_bytes",
+		Help:    "Size in bytes of UDP datagrams sent to relay destinations.",
+		Buckets: prometheus.LinearBuckets(128, 128, 12),
+	})
+
+	relayErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "statsd_exporter_relay_errors_total",
+		Help: "The total number of errors sending to a relay destination.",
+	}, []string{"address"})
+)
+
+func init() {
+	prometheus.MustRegister(relayLinesTotal, relayPacketsTotal, relayPacketBytes, relayErrorsTotal)
+}
+
+// relayDestination batches outgoing lines for one downstream address, up to
+// maxSize bytes, so several metrics can share a single UDP datagram.
+type relayDestination struct {
+	mu      sync.Mutex
+	address string
+	conn    net.Conn
+	buf     strings.Builder
+	maxSize int
+	logger  log.Logger
+}
+
+func newRelayDestination(address string, maxSize int, logger log.Logger) (*relayDestination, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &relayDestination{address: address, conn: conn, maxSize: maxSize, logger: logger}, nil
+}
+
+func (d *relayDestination) send(line string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.buf.Len() > 0 && d.buf.Len()+1+len(line) > d.maxSize {
+		d.flushLocked()
+	}
+	if d.buf.Len() > 0 {
+		d.buf.WriteByte('\n')
+	}
+	d.buf.WriteString(line)
+	relayLinesTotal.Inc()
+
+	if d.buf.Len() >= d.maxSize {
+		d.flushLocked()
+	}
+}
+
+func (d *relayDestination) flushLocked() {
+	if d.buf.Len() == 0 {
+		return
+	}
+	payload := d.buf.String()
+	d.buf.Reset()
+
+	if _, err := d.conn.Write([]byte(payload)); err != nil {
+		level.Debug(d.logger).Log("msg", "Failed to relay StatsD packet", "address", d.address, "error", err)
+		relayErrorsTotal.WithLabelValues(d.address).Inc()
+		return
+	}
+	relayPacketsTotal.Inc()
+	relayPacketBytes.Observe(float64(len(payload)))
+}
+
+func (d *relayDestination) flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flushLocked()
+}
+
+// Relay forwards relayed events, re-serialized as StatsD/DogStatsD lines,
+// to one or more downstream StatsD backends, batching several lines into
+// one UDP datagram where the combined size allows.
+type Relay struct {
+	destinations []*relayDestination
+}
+
+// NewRelay dials a UDP socket for each address and returns a Relay that
+// batches outgoing lines up to maxPacketSize bytes per datagram.
+func NewRelay(addresses []string, maxPacketSize int, logger log.Logger) (*Relay, error) {
+	if maxPacketSize <= 0 {
+		maxPacketSize = defaultRelayMaxPacketSize
+	}
+
+	destinations := make([]*relayDestination, 0, len(addresses))
+	for _, address := range addresses {
+		d, err := newRelayDestination(address, maxPacketSize, logger)
+		if err != nil {
+			return nil, fmt.Errorf("relay: dialing %s: %w", address, err)
+		}
+		destinations = append(destinations, d)
+	}
+	return &Relay{destinations: destinations}, nil
+}
+
+// Send forwards line to every configured relay destination.
+func (r *Relay) Send(line string) {
+	for _, d := range r.destinations {
+		d.send(line)
+	}
+}
+
+// Flush forces out any partially-filled batches, e.g. on shutdown.
+func (r *Relay) Flush() {
+	for _, d := range r.destinations {
+		d.flush()
+	}
+}
+
+// relayLine re-serializes event as a StatsD/DogStatsD line suitable for
+// forwarding downstream. ok is false for event types that have no wire
+// representation worth forwarding.
+func relayLine(event Event) (line string, ok bool) {
+	tags := dogStatsDTagSuffix(event.Labels())
+
+	switch ev := event.(type) {
+	case *CounterEvent:
+		return fmt.Sprintf("%s:%v|c%s", ev.metricName, ev.value, tags), true
+	case *GaugeEvent:
+		return fmt.Sprintf("%s:%v|g%s", ev.metricName, ev.value, tags), true
+	case *TimerEvent:
+		return fmt.Sprintf("%s:%v|ms%s", ev.metricName, ev.value, tags), true
+	case *SetEvent:
+		return fmt.Sprintf("%s:%s|s%s", ev.metricName, ev.value, tags), true
+	case *EventEvent:
+		return fmt.Sprintf("_e{%d,%d}:%s|%s|t:%s%s", len(ev.title), len(ev.text), ev.title, ev.text, ev.alertType, tags), true
+	case *ServiceCheckEvent:
+		return fmt.Sprintf("_sc|%s|%v%s", ev.metricName, ev.status, tags), true
+	default:
+		return "", false
+	}
+}
+
+func dogStatsDTagSuffix(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	tags := make([]string, 0, len(labels))
+	for k, v := range labels {
+		tags = append(tags, k+":"+v)
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
@@ -0,0 +1,48 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/go-kit/kit/log"
+	"golang.org/x/sys/unix"
+)
+
+// controlReusePort returns a net.ListenConfig.Control callback that sets
+// SO_REUSEPORT on the listening socket, letting multiple receive goroutines
+// bind the same address/port so incoming packets fan out across them. On
+// platforms without SO_REUSEPORT this is a no-op (see sockopt_other.go).
+func controlReusePort(reusePort bool) func(network, address string, c syscall.RawConn) error {
+	if !reusePort {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// warnReusePortUnsupported is a no-op on Linux, where controlReusePort
+// actually honors reusePort (see sockopt_other.go for the platforms where
+// it can't).
+func warnReusePortUnsupported(logger log.Logger) {}
@@ -0,0 +1,35 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// controlReusePort is a no-op outside of Linux: SO_REUSEPORT isn't
+// available, so only a single receive goroutine can bind a given address.
+func controlReusePort(reusePort bool) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+// warnReusePortUnsupported logs a warning, on each call, that
+// --statsd.reuse-port was requested on a platform that can't honor it.
+func warnReusePortUnsupported(logger log.Logger) {
+	level.Warn(logger).Log("msg", "SO_REUSEPORT is only supported on Linux; falling back to a single listener")
+}